@@ -2,6 +2,11 @@ package controller
 
 import (
 	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
 	configMapcontroller "github.com/dm0275/configmap-replicator/pkg/controller"
 	"github.com/dm0275/configmap-replicator/utils"
 	"github.com/spf13/cobra"
@@ -10,7 +15,16 @@ import (
 )
 
 type ControllerConfig struct {
-	ReconciliationInterval string
+	ReconciliationInterval    string
+	Workers                   int
+	Resources                 []string
+	LeaderElect               bool
+	LeaderElectLeaseName      string
+	LeaderElectLeaseNamespace string
+	LeaderElectLeaseDuration  time.Duration
+	LeaderElectRenewDeadline  time.Duration
+	LeaderElectRetryPeriod    time.Duration
+	MetricsBindAddress        string
 }
 
 func Run(config *rest.Config) {
@@ -19,7 +33,20 @@ func Run(config *rest.Config) {
 		Use: "configmap-replicator",
 		Run: func(cmd *cobra.Command, args []string) {
 			// Initialize Controller
-			controller := configMapcontroller.NewConfigMapReplicatorController(config, controllerConfig.ReconciliationInterval)
+			leaderElectionConfig := &configMapcontroller.LeaderElectionConfig{
+				Enabled:        controllerConfig.LeaderElect,
+				LeaseName:      controllerConfig.LeaderElectLeaseName,
+				LeaseNamespace: controllerConfig.LeaderElectLeaseNamespace,
+				LeaseDuration:  controllerConfig.LeaderElectLeaseDuration,
+				RenewDeadline:  controllerConfig.LeaderElectRenewDeadline,
+				RetryPeriod:    controllerConfig.LeaderElectRetryPeriod,
+			}
+
+			controller := configMapcontroller.NewReplicatorController(config, controllerConfig.ReconciliationInterval, controllerConfig.Workers, controllerConfig.Resources, leaderElectionConfig)
+
+			if controllerConfig.MetricsBindAddress != "" {
+				go serveMetrics(controller, controllerConfig.MetricsBindAddress)
+			}
 
 			// Initialize context
 			ctx := context.Background()
@@ -38,6 +65,46 @@ func Run(config *rest.Config) {
 
 func configureFlags(cmd *cobra.Command, config *ControllerConfig) {
 	reconciliationInterval := utils.GetEnv("REPLICATOR_INTERVAL", "1m")
+	workers, err := strconv.Atoi(utils.GetEnv("REPLICATOR_WORKERS", "2"))
+	if err != nil {
+		workers = 2
+	}
+	resources := strings.Split(utils.GetEnv("REPLICATOR_RESOURCES", configMapcontroller.ResourceConfigMaps), ",")
 
 	cmd.Flags().StringVarP(&config.ReconciliationInterval, "reconciliation-interval", "", reconciliationInterval, "configures the reconciliation interval of the controller")
+	cmd.Flags().IntVarP(&config.Workers, "workers", "", workers, "configures the number of worker goroutines processing the replication queue")
+	cmd.Flags().StringSliceVarP(&config.Resources, "resources", "", resources, "resource kinds to replicate, e.g. configmaps,secrets")
+
+	cmd.Flags().BoolVarP(&config.LeaderElect, "leader-elect", "", false, "enables leader election so multiple replicas of the controller can run HA")
+	cmd.Flags().StringVarP(&config.LeaderElectLeaseName, "leader-elect-lease-name", "", "configmap-replicator", "name of the Lease object used for leader election")
+	cmd.Flags().StringVarP(&config.LeaderElectLeaseNamespace, "leader-elect-lease-namespace", "", "default", "namespace of the Lease object used for leader election")
+	cmd.Flags().DurationVarP(&config.LeaderElectLeaseDuration, "leader-elect-lease-duration", "", 15*time.Second, "duration non-leader candidates wait before attempting to acquire leadership")
+	cmd.Flags().DurationVarP(&config.LeaderElectRenewDeadline, "leader-elect-renew-deadline", "", 10*time.Second, "duration the leader will retry refreshing leadership before giving it up")
+	cmd.Flags().DurationVarP(&config.LeaderElectRetryPeriod, "leader-elect-retry-period", "", 2*time.Second, "duration clients should wait between tries of actions")
+
+	metricsBindAddress := utils.GetEnv("REPLICATOR_METRICS_BIND_ADDRESS", ":8080")
+	cmd.Flags().StringVarP(&config.MetricsBindAddress, "metrics-bind-address", "", metricsBindAddress, "address the /metrics, /healthz and /readyz endpoints are served on; empty disables the server")
+}
+
+// serveMetrics serves the controller's /metrics, /healthz and /readyz endpoints on bindAddress
+// until the process exits. /readyz reports healthy once every informer cache has synced.
+func serveMetrics(controller *configMapcontroller.ReplicatorController, bindAddress string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", controller.MetricsHandler())
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, r *http.Request) {
+		if !controller.CachesSynced() {
+			http.Error(w, "caches not synced", http.StatusServiceUnavailable)
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	})
+
+	klog.Infof("Serving metrics and health endpoints on %s", bindAddress)
+	if err := http.ListenAndServe(bindAddress, mux); err != nil {
+		klog.Errorf("Error serving metrics and health endpoints: %v", err)
+	}
 }
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const configMapAnnotationPrefix = "configmap-replicator"
+
+// configMapStrategy implements ReplicatorStrategy for v1.ConfigMap.
+type configMapStrategy struct {
+	clientset kubernetes.Interface
+	informer  cache.SharedIndexInformer
+	lister    corelisters.ConfigMapLister
+}
+
+func newConfigMapStrategy(clientset kubernetes.Interface, informerFactory informers.SharedInformerFactory) *configMapStrategy {
+	informer := informerFactory.Core().V1().ConfigMaps()
+
+	return &configMapStrategy{
+		clientset: clientset,
+		informer:  informer.Informer(),
+		lister:    informer.Lister(),
+	}
+}
+
+func (s *configMapStrategy) Kind() string                        { return "ConfigMap" }
+func (s *configMapStrategy) AnnotationPrefix() string             { return configMapAnnotationPrefix }
+func (s *configMapStrategy) Informer() cache.SharedIndexInformer { return s.informer }
+
+func (s *configMapStrategy) GetCached(namespace, name string) (replicatedObject, error) {
+	return s.lister.ConfigMaps(namespace).Get(name)
+}
+
+func (s *configMapStrategy) ShouldSkip(_ replicatedObject) (bool, string) {
+	return false, ""
+}
+
+func (s *configMapStrategy) GetLive(ctx context.Context, ns, name string) (replicatedObject, error) {
+	return s.clientset.CoreV1().ConfigMaps(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (s *configMapStrategy) BuildReplica(source replicatedObject, ns string) replicatedObject {
+	configMap := source.(*v1.ConfigMap)
+
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      configMap.Name,
+			Namespace: ns,
+			Annotations: map[string]string{
+				fmt.Sprintf("%s/%s", configMapAnnotationPrefix, replicatedFromKey): configMap.Namespace + "_" + configMap.Name,
+			},
+		},
+		Data: configMap.Data,
+	}
+}
+
+func (s *configMapStrategy) NeedsUpdate(current, source replicatedObject) bool {
+	currentConfigMap := current.(*v1.ConfigMap)
+	sourceConfigMap := source.(*v1.ConfigMap)
+	replicatedFromAnnotation := fmt.Sprintf("%s/%s", configMapAnnotationPrefix, replicatedFromKey)
+	replicatedFromValue := sourceConfigMap.Namespace + "_" + sourceConfigMap.Name
+
+	return !equality.Semantic.DeepEqual(currentConfigMap.Data, sourceConfigMap.Data) ||
+		currentConfigMap.Annotations[replicatedFromAnnotation] != replicatedFromValue
+}
+
+func (s *configMapStrategy) MergePatch(current, source replicatedObject) ([]byte, error) {
+	currentConfigMap := current.(*v1.ConfigMap)
+	sourceConfigMap := source.(*v1.ConfigMap)
+
+	desired := currentConfigMap.DeepCopy()
+	desired.Data = sourceConfigMap.Data
+	if desired.Annotations == nil {
+		desired.Annotations = map[string]string{}
+	}
+	desired.Annotations[fmt.Sprintf("%s/%s", configMapAnnotationPrefix, replicatedFromKey)] = sourceConfigMap.Namespace + "_" + sourceConfigMap.Name
+
+	return computeMergePatch(currentConfigMap, desired)
+}
+
+func (s *configMapStrategy) Create(ctx context.Context, ns string, replica replicatedObject) error {
+	_, err := s.clientset.CoreV1().ConfigMaps(ns).Create(ctx, replica.(*v1.ConfigMap), metav1.CreateOptions{})
+	return err
+}
+
+func (s *configMapStrategy) Patch(ctx context.Context, ns, name string, patch []byte) error {
+	_, err := s.clientset.CoreV1().ConfigMaps(ns).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (s *configMapStrategy) Delete(ctx context.Context, ns, name string) error {
+	return s.clientset.CoreV1().ConfigMaps(ns).Delete(ctx, name, metav1.DeleteOptions{})
+}
@@ -0,0 +1,108 @@
+package controller
+
+import (
+	"encoding/json"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestConfigMapStrategyNeedsUpdate(t *testing.T) {
+	s := &configMapStrategy{}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "src-ns", Name: "cm"},
+		Data:       map[string]string{"key": "new-value"},
+	}
+
+	tests := []struct {
+		name    string
+		current *corev1.ConfigMap
+		want    bool
+	}{
+		{
+			name: "data has drifted from source",
+			current: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cm",
+					Annotations: map[string]string{
+						"configmap-replicator/replicated-from": "src-ns_cm",
+					},
+				},
+				Data: map[string]string{"key": "old-value"},
+			},
+			want: true,
+		},
+		{
+			name: "replicated-from annotation is missing",
+			current: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{Name: "cm"},
+				Data:       map[string]string{"key": "new-value"},
+			},
+			want: true,
+		},
+		{
+			name: "data and annotation already match source",
+			current: &corev1.ConfigMap{
+				ObjectMeta: metav1.ObjectMeta{
+					Name: "cm",
+					Annotations: map[string]string{
+						"configmap-replicator/replicated-from": "src-ns_cm",
+					},
+				},
+				Data: map[string]string{"key": "new-value"},
+			},
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := s.NeedsUpdate(tt.current, source); got != tt.want {
+				t.Errorf("NeedsUpdate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConfigMapStrategyMergePatch(t *testing.T) {
+	s := &configMapStrategy{}
+	source := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{Namespace: "src-ns", Name: "cm"},
+		Data:       map[string]string{"key": "new-value"},
+	}
+	current := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cm",
+			Namespace: "target-ns",
+			Labels:    map[string]string{"owner": "someone-else"},
+		},
+		Data: map[string]string{"key": "old-value"},
+	}
+
+	patch, err := s.MergePatch(current, source)
+	if err != nil {
+		t.Fatalf("MergePatch() unexpected error: %v", err)
+	}
+
+	var decoded struct {
+		Data     map[string]string `json:"data"`
+		Metadata struct {
+			Labels      map[string]string `json:"labels"`
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	if err := json.Unmarshal(patch, &decoded); err != nil {
+		t.Fatalf("failed to unmarshal patch %s: %v", patch, err)
+	}
+
+	if decoded.Data["key"] != "new-value" {
+		t.Errorf("patch data[key] = %q, want %q", decoded.Data["key"], "new-value")
+	}
+	if decoded.Metadata.Annotations["configmap-replicator/replicated-from"] != "src-ns_cm" {
+		t.Errorf("patch did not stamp replicated-from annotation: %v", decoded.Metadata.Annotations)
+	}
+	if _, ok := decoded.Metadata.Labels["owner"]; ok {
+		t.Errorf("patch unexpectedly touched untouched label owner: %v", decoded.Metadata.Labels)
+	}
+}
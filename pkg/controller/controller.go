@@ -3,38 +3,53 @@ package controller
 import (
 	"context"
 	"fmt"
-	"github.com/dm0275/configmap-replicator/utils"
-	v1 "k8s.io/api/core/v1"
-	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"net/http"
+
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/util/wait"
-	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/informers"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"k8s.io/klog/v2"
-	"strconv"
-	"strings"
+	"os"
 	"time"
 )
 
-var (
-	annotationKey         = "configmap-replicator"
-	replicatedFromKey     = "replicated-from"
-	replicationAllowedKey = "replication-allowed"
-	allowedNamespacesKey  = "allowed-namespaces"
-	excludedNamespacesKey = "excluded-namespaces"
+// Supported values for the --resources flag.
+const (
+	ResourceConfigMaps = "configmaps"
+	ResourceSecrets    = "secrets"
 )
 
-// ConfigMapReplicatorController is responsible for replicating ConfigMaps.
-type ConfigMapReplicatorController struct {
+// LeaderElectionConfig configures whether the controller runs leader election before starting its
+// informers and workqueues, allowing multiple replicas of the controller to run HA.
+type LeaderElectionConfig struct {
+	Enabled        bool
+	LeaseName      string
+	LeaseNamespace string
+	LeaseDuration  time.Duration
+	RenewDeadline  time.Duration
+	RetryPeriod    time.Duration
+}
+
+// ReplicatorController replicates each enabled resource kind (ConfigMaps, Secrets, ...) across
+// namespaces, with its own informer and workqueue per kind.
+type ReplicatorController struct {
 	clientset              *kubernetes.Clientset
+	informerFactory        informers.SharedInformerFactory
+	namespaceInformer      cache.SharedIndexInformer
+	kindReplicators        []*kindReplicator
+	leaderElectionConfig   *LeaderElectionConfig
 	ReconciliationInterval *time.Duration
+	Metrics                *Metrics
 }
 
-// NewConfigMapReplicatorController creates a new instance of the ConfigMapReplicatorController.
-func NewConfigMapReplicatorController(config *rest.Config, reconciliationInterval string) *ConfigMapReplicatorController {
+// NewReplicatorController creates a new ReplicatorController, wiring up one informer/workqueue
+// pair for each kind named in resources (see the Resource* constants).
+func NewReplicatorController(config *rest.Config, reconciliationInterval string, workers int, resources []string, leaderElectionConfig *LeaderElectionConfig) *ReplicatorController {
 	interval, err := time.ParseDuration(reconciliationInterval)
 	if err != nil {
 		klog.Fatalf("Invalid reconciliation interval %s: %v\n", reconciliationInterval, err)
@@ -46,271 +61,159 @@ func NewConfigMapReplicatorController(config *rest.Config, reconciliationInterva
 		klog.Fatalf("Error creating Kubernetes clientset: %v\n", err)
 	}
 
-	controller := &ConfigMapReplicatorController{
+	informerFactory := informers.NewSharedInformerFactory(clientset, interval)
+	namespaceInformer := informerFactory.Core().V1().Namespaces()
+	metrics := NewMetrics()
+	eventRecorder := newEventRecorder(clientset)
+
+	controller := &ReplicatorController{
 		clientset:              clientset,
+		informerFactory:        informerFactory,
+		namespaceInformer:      namespaceInformer.Informer(),
+		leaderElectionConfig:   leaderElectionConfig,
 		ReconciliationInterval: &interval,
+		Metrics:                metrics,
 	}
 
-	return controller
-}
-
-func (c *ConfigMapReplicatorController) validateConfiguration(configMap *v1.ConfigMap) error {
-	allowedNamespaces := c.getAllowedNamespaces(configMap)
-	excludedNamespaces := c.getExcludedNamespaces(configMap)
-
-	if utils.SlicesOverlap(allowedNamespaces, excludedNamespaces) {
-		return fmt.Errorf("ERROR: Unable to replicate ConfigMap %s, cannot have overlaps between allowedNamespaces and excludedNamespaces", configMap.Name)
+	namespaceInformer.Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: controller.handleNamespaceEvent,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			controller.handleNamespaceEvent(newObj)
+		},
+	})
+
+	for _, resource := range resources {
+		switch resource {
+		case ResourceConfigMaps:
+			controller.kindReplicators = append(controller.kindReplicators, newKindReplicator(newConfigMapStrategy(clientset, informerFactory), workers, namespaceInformer.Lister(), eventRecorder, metrics))
+		case ResourceSecrets:
+			controller.kindReplicators = append(controller.kindReplicators, newKindReplicator(newSecretStrategy(clientset, informerFactory), workers, namespaceInformer.Lister(), eventRecorder, metrics))
+		default:
+			klog.Fatalf("Unsupported resource %q, must be one of: %s, %s", resource, ResourceConfigMaps, ResourceSecrets)
+		}
 	}
 
-	return nil
+	return controller
 }
 
-// Replicate the given ConfigMap to all namespaces
-func (c *ConfigMapReplicatorController) addConfigMapAcrossNamespaces(ctx context.Context, configMap *v1.ConfigMap) {
-	// Validate configmap configuration
-	err := c.validateConfiguration(configMap)
-	if err != nil {
-		klog.Errorf(err.Error())
+// handleNamespaceEvent re-enqueues the source objects of every kind whose namespace-selector
+// annotation now matches ns, so a namespace that starts matching a source gets populated
+// immediately instead of waiting for the next reconcile.
+func (c *ReplicatorController) handleNamespaceEvent(obj interface{}) {
+	ns, ok := obj.(metav1.Object)
+	if !ok {
 		return
 	}
 
-	if c.replicateEnabled(configMap) {
-		allowedNamespaces := c.getAllowedNamespaces(configMap)
-		if len(allowedNamespaces) > 0 {
-			for _, ns := range allowedNamespaces {
-				// Create a new ConfigMap
-				go c.createConfigMap(ctx, configMap, ns)
-			}
-		} else {
-			namespaces, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
-			if err != nil {
-				klog.Errorf("Error listing namespaces: %v", err)
-				return
-			}
-
-			for _, ns := range namespaces.Items {
-				excludedNamespaces := c.getExcludedNamespaces(configMap)
-				if configMap.Namespace == ns.Name {
-					klog.Infof("ConfigMap %s in the %s namespace is a source ConfigMap", configMap.Name, configMap.Namespace)
-					continue
-				} else if utils.ListContains(excludedNamespaces, ns.Name) {
-					klog.Infof("Namespace %s is an excluded Namespace. Not replicating ConfigMap %s to Namespace %s.", ns.Name, configMap.Name, ns.Name)
-					continue
-				} else {
-					// Create a new ConfigMap in each namespace
-					go c.createConfigMap(ctx, configMap, ns.Name)
-				}
-			}
-		}
+	for _, kr := range c.kindReplicators {
+		kr.enqueueSourcesMatchingNamespace(ns)
 	}
 }
 
-func (c *ConfigMapReplicatorController) createConfigMap(ctx context.Context, configMap *v1.ConfigMap, ns string) {
-	// Create a new ConfigMap in each namespace
-	newConfigMap := &v1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      configMap.Name,
-			Namespace: ns,
-			Annotations: map[string]string{
-				fmt.Sprintf("%s/%s", annotationKey, replicatedFromKey): configMap.Namespace + "_" + configMap.Name,
-			},
-		},
-		Data: configMap.Data,
+// Run starts the controller, optionally gated behind leader election so that multiple replicas of
+// the controller can run HA without duplicating writes.
+func (c *ReplicatorController) Run(ctx context.Context) error {
+	if c.leaderElectionConfig == nil || !c.leaderElectionConfig.Enabled {
+		return c.runController(ctx)
 	}
 
-	_, err := c.clientset.CoreV1().ConfigMaps(ns).Create(ctx, newConfigMap, metav1.CreateOptions{})
-	if err != nil {
-		klog.Errorf("Error replicating ConfigMap to namespace %s: %v", ns, err)
-	} else {
-		klog.Infof("Replicated ConfigMap %s to namespace %s", configMap.Name, ns)
-	}
+	return c.runWithLeaderElection(ctx)
 }
 
-func (c *ConfigMapReplicatorController) updateConfigMap(ctx context.Context, configMap *v1.ConfigMap, ns string) {
-	updatedConfigMap := &v1.ConfigMap{
-		ObjectMeta: metav1.ObjectMeta{
-			Name:      configMap.Name,
-			Namespace: ns,
-			Annotations: map[string]string{
-				fmt.Sprintf("%s/%s", annotationKey, replicatedFromKey): configMap.Namespace + "_" + configMap.Name,
-			},
-		},
-		Data: configMap.Data,
-	}
-
-	_, err := c.clientset.CoreV1().ConfigMaps(ns).Get(ctx, updatedConfigMap.Name, metav1.GetOptions{})
+// runWithLeaderElection blocks acquiring a Lease lock and only starts the controller while this
+// process holds the lease, stopping it as soon as leadership is lost.
+func (c *ReplicatorController) runWithLeaderElection(ctx context.Context) error {
+	id, err := os.Hostname()
 	if err != nil {
-		if k8sErrors.IsNotFound(err) {
-			_, err = c.clientset.CoreV1().ConfigMaps(ns).Create(ctx, updatedConfigMap, metav1.CreateOptions{})
-			if err != nil {
-				klog.Errorf("Error replicating ConfigMap to namespace %s: %v", ns, err)
-			} else {
-				klog.Infof("Replicated ConfigMap %s to namespace %s", updatedConfigMap.Name, ns)
-			}
-			return
-		} else {
-			klog.Errorf("Error fetching ConfigMap %s in namespace %s", updatedConfigMap.Name, ns)
-			return
-		}
+		return fmt.Errorf("error determining hostname for leader election identity: %w", err)
 	}
 
-	_, err = c.clientset.CoreV1().ConfigMaps(ns).Update(ctx, updatedConfigMap, metav1.UpdateOptions{})
-	if err != nil {
-		klog.Errorf("Error replicating ConfigMap to namespace %s: %v", ns, err)
-	} else {
-		klog.Infof("Updated ConfigMap %s in namespace %s", updatedConfigMap.Name, ns)
-	}
-}
-
-func (c *ConfigMapReplicatorController) updateConfigMapAcrossNamespaces(ctx context.Context, currentConfigMap *v1.ConfigMap, updatedConfigMap *v1.ConfigMap) {
-	// Validate configmap configuration
-	err := c.validateConfiguration(updatedConfigMap)
-	if err != nil {
-		klog.Errorf(err.Error())
-		return
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      c.leaderElectionConfig.LeaseName,
+			Namespace: c.leaderElectionConfig.LeaseNamespace,
+		},
+		Client: c.clientset.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{
+			Identity: id,
+		},
 	}
 
-	if c.replicateEnabled(updatedConfigMap) {
-		allowedNamespaces := c.getAllowedNamespaces(updatedConfigMap)
-		if len(allowedNamespaces) > 0 {
-			for _, ns := range allowedNamespaces {
-				// Update ConfigMap
-				go c.updateConfigMap(ctx, updatedConfigMap, ns)
-			}
-		} else {
-			namespaces, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
-			if err != nil {
-				klog.Errorf("Error listing namespaces: %v", err)
-				return
-			}
-
-			for _, ns := range namespaces.Items {
-				excludedNamespaces := c.getExcludedNamespaces(updatedConfigMap)
-				if updatedConfigMap.Namespace == ns.Name {
-					klog.Infof("ConfigMap %s in the %s namespace is a source ConfigMap", updatedConfigMap.Name, updatedConfigMap.Namespace)
-					continue
-				} else if utils.ListContains(excludedNamespaces, ns.Name) {
-					klog.Infof("Namespace %s is an excluded Namespace. Not replicating ConfigMap %s to Namespace %s.", ns.Name, updatedConfigMap.Name, ns.Name)
-					continue
-				} else {
-					// Update ConfigMap
-					go c.updateConfigMap(ctx, updatedConfigMap, ns.Name)
-				}
-			}
-		}
-	}
-}
+	var cancelController context.CancelFunc
 
-func (c *ConfigMapReplicatorController) deleteConfigMapAcrossNamespaces(ctx context.Context, configMap *v1.ConfigMap) {
-	// Validate configmap configuration
-	err := c.validateConfiguration(configMap)
-	if err != nil {
-		klog.Errorf(err.Error())
-		return
-	}
+	leaderelection.RunOrDie(ctx, leaderelection.LeaderElectionConfig{
+		Lock:            lock,
+		ReleaseOnCancel: true,
+		LeaseDuration:   c.leaderElectionConfig.LeaseDuration,
+		RenewDeadline:   c.leaderElectionConfig.RenewDeadline,
+		RetryPeriod:     c.leaderElectionConfig.RetryPeriod,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leadingCtx context.Context) {
+				klog.Infof("%s started leading", id)
 
-	if c.replicateEnabled(configMap) {
-		namespaces, err := c.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
-		if err != nil {
-			klog.Errorf("Error listing namespaces: %v", err)
-			return
-		}
+				var controllerCtx context.Context
+				controllerCtx, cancelController = context.WithCancel(leadingCtx)
 
-		for _, ns := range namespaces.Items {
-			if configMap.Namespace == ns.Name {
-				continue
-			}
-
-			excludedNamespaces := c.getExcludedNamespaces(configMap)
-			if utils.ListContains(excludedNamespaces, ns.Name) {
-				klog.Infof("Namespace %s is an excluded Namespace. Not replicating ConfigMap %s to Namespace %s.", ns.Name, configMap.Name, ns.Name)
-				continue
-			} else {
-				err = c.clientset.CoreV1().ConfigMaps(ns.Name).Delete(ctx, configMap.Name, metav1.DeleteOptions{})
-				if err != nil {
-					klog.Errorf("Error deleting ConfigMap in namespace %s: %v", ns.Name, err)
-				} else {
-					klog.Infof("Deleted ConfigMap %s in namespace %s", configMap.Name, ns.Name)
+				if err := c.runController(controllerCtx); err != nil {
+					klog.Errorf("Error running controller: %v", err)
 				}
-			}
-		}
-	}
-}
-
-// Run starts the controller and watches for ConfigMap changes.
-func (c *ConfigMapReplicatorController) Run(ctx context.Context) error {
-	// The informer is used to watch and react to changes in resources, in this case ConfigMaps.
-	_, controller := cache.NewInformer(
-		// The first arg is a `cache.ListWatch` object. This object specifies how to list and watch for changes in the ConfigMaps.
-		&cache.ListWatch{
-			// The `ListFunc` is responsible for listing the ConfigMaps
-			ListFunc: func(lo metav1.ListOptions) (runtime.Object, error) {
-				return c.clientset.CoreV1().ConfigMaps("").List(ctx, lo)
-			},
-			// The `WatchFunc` is responsible for setting up a watch on the ConfigMaps. It returns a watch.Interface that will notify the controller of any changes to the watched resources.
-			WatchFunc: func(lo metav1.ListOptions) (watch.Interface, error) {
-				return c.clientset.CoreV1().ConfigMaps("").Watch(ctx, lo)
-			},
-		},
-		// The second arg is the type of the resource we are watching. In this case, a ConfigMap.
-		&v1.ConfigMap{},
-		// The third arg is the resync period(time.Duration), this specifies how often the informer should perform a full re-list of the resources, even if no changes have occurred. This helps ensure that your controller has up-to-date information.
-		*c.ReconciliationInterval,
-		// The fourth arg is a set of event handler functions. These functions define what happens when resources are added, updated, or deleted.
-		cache.ResourceEventHandlerFuncs{
-			AddFunc: func(obj interface{}) {
-				// Replicate the ConfigMap to all namespaces
-				configMap := obj.(*v1.ConfigMap)
-				c.addConfigMapAcrossNamespaces(ctx, configMap)
-			},
-			UpdateFunc: func(currentObj, newObj interface{}) {
-				// Handle ConfigMap updates
-				currentConfigMap := currentObj.(*v1.ConfigMap)
-				updatedConfigMap := currentObj.(*v1.ConfigMap)
-				c.updateConfigMapAcrossNamespaces(ctx, currentConfigMap, updatedConfigMap)
 			},
-			DeleteFunc: func(obj interface{}) {
-				// Handle ConfigMap deletions
-				configMap := obj.(*v1.ConfigMap)
-				c.deleteConfigMapAcrossNamespaces(ctx, configMap)
+			OnStoppedLeading: func() {
+				klog.Infof("%s stopped leading", id)
+				if cancelController != nil {
+					cancelController()
+				}
 			},
 		},
-	)
-
-	// Start the controller and make it run indefinitely to continuously monitor resources as changes occur in the cluster.
-	controller.Run(wait.NeverStop)
+	})
 
 	return nil
 }
 
-func (c *ConfigMapReplicatorController) replicateEnabled(configMap *v1.ConfigMap) bool {
-	replicationAllowed, ok := configMap.Annotations[fmt.Sprintf("%s/%s", annotationKey, replicationAllowedKey)]
-	if !ok {
-		return false
-	}
+// runController starts the informer factory, waits for every kind's informer cache to sync, and
+// then starts each kind's workers, blocking until ctx is cancelled.
+func (c *ReplicatorController) runController(ctx context.Context) error {
+	klog.Info("Starting replicator controller")
+	c.informerFactory.Start(ctx.Done())
 
-	replicationAllowedBool, err := strconv.ParseBool(replicationAllowed)
-	if err != nil {
-		return false
+	klog.Info("Waiting for informer caches to sync")
+	syncedFuncs := []cache.InformerSynced{c.namespaceInformer.HasSynced}
+	for _, kr := range c.kindReplicators {
+		syncedFuncs = append(syncedFuncs, kr.informer.HasSynced)
 	}
 
-	return replicationAllowedBool
-}
+	if !cache.WaitForCacheSync(ctx.Done(), syncedFuncs...) {
+		return fmt.Errorf("failed to wait for caches to sync")
+	}
 
-func (c *ConfigMapReplicatorController) getAllowedNamespaces(configMap *v1.ConfigMap) []string {
-	allowedNamespaces, ok := configMap.Annotations[fmt.Sprintf("%s/%s", annotationKey, allowedNamespacesKey)]
-	if !ok {
-		return []string{}
+	for _, kr := range c.kindReplicators {
+		go kr.run(ctx)
 	}
 
-	return strings.Split(allowedNamespaces, ",")
+	<-ctx.Done()
+	klog.Info("Shutting down replicator controller")
+
+	return nil
 }
 
-func (c *ConfigMapReplicatorController) getExcludedNamespaces(configMap *v1.ConfigMap) []string {
-	excludedNamespaces, ok := configMap.Annotations[fmt.Sprintf("%s/%s", annotationKey, excludedNamespacesKey)]
-	if !ok {
-		return []string{}
+// CachesSynced reports whether every informer's cache has finished its initial sync. It is
+// non-blocking and safe to call at any time, including before the controller starts running, so
+// it can back a readiness probe.
+func (c *ReplicatorController) CachesSynced() bool {
+	if !c.namespaceInformer.HasSynced() {
+		return false
+	}
+
+	for _, kr := range c.kindReplicators {
+		if !kr.informer.HasSynced() {
+			return false
+		}
 	}
 
-	return strings.Split(excludedNamespaces, ",")
+	return true
+}
+
+// MetricsHandler returns an http.Handler serving the controller's Prometheus metrics.
+func (c *ReplicatorController) MetricsHandler() http.Handler {
+	return promhttp.HandlerFor(c.Metrics.Registry, promhttp.HandlerOpts{})
 }
@@ -0,0 +1,29 @@
+package controller
+
+import (
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/klog/v2"
+)
+
+// Event reasons recorded on source objects as the controller replicates them.
+const (
+	EventReplicatedTo     = "ReplicatedTo"
+	EventUpdatedIn        = "UpdatedIn"
+	EventDeletedFrom      = "DeletedFrom"
+	EventSkippedNamespace = "SkippedNamespace"
+	EventValidationFailed = "ValidationFailed"
+)
+
+// newEventRecorder returns an EventRecorder that publishes events against clientset under the
+// configmap-replicator component, so they show up alongside the source object via `kubectl describe`.
+func newEventRecorder(clientset kubernetes.Interface) record.EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartLogging(klog.Infof)
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: clientset.CoreV1().Events("")})
+
+	return broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: "configmap-replicator"})
+}
@@ -0,0 +1,42 @@
+package controller
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Metrics holds the Prometheus collectors the controller updates as it reconciles source objects.
+type Metrics struct {
+	Registry          *prometheus.Registry
+	ReplicationsTotal *prometheus.CounterVec
+	ManagedReplicas   *prometheus.GaugeVec
+	ReconcileDuration *prometheus.HistogramVec
+}
+
+// NewMetrics creates a Prometheus registry with the controller's collectors registered on it.
+func NewMetrics() *Metrics {
+	replicationsTotal := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "configmap_replicator_replications_total",
+		Help: "Total number of replication actions performed, by action (create, update, delete) and result (success, error).",
+	}, []string{"action", "result"})
+
+	managedReplicas := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "configmap_replicator_managed_replicas",
+		Help: "Number of replicas currently managed for a source object.",
+	}, []string{"source_namespace", "source_name"})
+
+	reconcileDuration := prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "configmap_replicator_reconcile_duration_seconds",
+		Help:    "Time spent reconciling the replicas of a single source object.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"kind"})
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(replicationsTotal, managedReplicas, reconcileDuration)
+
+	return &Metrics{
+		Registry:          registry,
+		ReplicationsTotal: replicationsTotal,
+		ManagedReplicas:   managedReplicas,
+		ReconcileDuration: reconcileDuration,
+	}
+}
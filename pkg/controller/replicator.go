@@ -0,0 +1,487 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	jsonpatch "github.com/evanphx/json-patch"
+	"github.com/dm0275/configmap-replicator/utils"
+	corev1 "k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
+	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+	"k8s.io/klog/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	replicatedFromKey     = "replicated-from"
+	replicationAllowedKey = "replication-allowed"
+	allowedNamespacesKey  = "allowed-namespaces"
+	excludedNamespacesKey = "excluded-namespaces"
+	namespaceSelectorKey  = "namespace-selector"
+)
+
+// replicatedFromIndexName indexes each kind's informer by its replicated-from annotation value
+// (sourceNamespace_sourceName), so replicas of a given source can be looked up without scanning
+// every namespace.
+const replicatedFromIndexName = "replicatedFrom"
+
+// replicatedObject is the subset of metav1.Object and runtime.Object satisfied by every
+// replicated resource kind (ConfigMaps, Secrets, ...). Strategies operate on it so that, in
+// addition to reading/writing object metadata, the controller can record Events against the
+// object and pass it to the API client without a further type assertion.
+type replicatedObject interface {
+	metav1.Object
+	runtime.Object
+}
+
+// ReplicatorStrategy encapsulates the kind-specific behavior needed to replicate a single
+// Kubernetes resource kind (ConfigMaps, Secrets, ...) across namespaces. kindReplicator's
+// reconcile loop is written entirely in terms of this interface, so the allowed/excluded
+// namespace resolution, opt-in annotation handling and patch-based update behavior is shared
+// across kinds.
+type ReplicatorStrategy interface {
+	// Kind returns a human-readable name used for logging, e.g. "ConfigMap".
+	Kind() string
+	// AnnotationPrefix returns the prefix this kind's opt-in/config annotations are read from,
+	// e.g. "configmap-replicator" or "secret-replicator".
+	AnnotationPrefix() string
+	// Informer returns the SharedIndexInformer backing this strategy's lister.
+	Informer() cache.SharedIndexInformer
+	// GetCached returns the source object identified by namespace/name from the lister cache.
+	GetCached(namespace, name string) (replicatedObject, error)
+	// ShouldSkip allows a strategy to veto replication of source, e.g. Secrets of type
+	// kubernetes.io/service-account-token, which are blocked by default.
+	ShouldSkip(source replicatedObject) (skip bool, reason string)
+	// BuildReplica returns a new object to create when no replica exists yet in ns.
+	BuildReplica(source replicatedObject, ns string) replicatedObject
+	// NeedsUpdate reports whether the replica current has drifted from source and must be patched.
+	NeedsUpdate(current, source replicatedObject) bool
+	// MergePatch computes a JSON merge patch that brings current's replicator-owned fields (data
+	// plus the replicated-from annotation) in line with source, preserving everything else.
+	MergePatch(current, source replicatedObject) ([]byte, error)
+	// GetLive fetches the current replica of name from namespace ns directly from the API.
+	GetLive(ctx context.Context, ns, name string) (replicatedObject, error)
+	// Create creates replica in namespace ns.
+	Create(ctx context.Context, ns string, replica replicatedObject) error
+	// Patch applies patch (a JSON merge patch) to the replica identified by ns/name.
+	Patch(ctx context.Context, ns, name string, patch []byte) error
+	// Delete removes the replica identified by ns/name.
+	Delete(ctx context.Context, ns, name string) error
+}
+
+// kindReplicator drives the informer, workqueue and workers for a single ReplicatorStrategy.
+type kindReplicator struct {
+	strategy        ReplicatorStrategy
+	informer        cache.SharedIndexInformer
+	queue           workqueue.RateLimitingInterface
+	workers         int
+	namespaceLister corelisters.NamespaceLister
+	eventRecorder   record.EventRecorder
+	metrics         *Metrics
+}
+
+func newKindReplicator(strategy ReplicatorStrategy, workers int, namespaceLister corelisters.NamespaceLister, eventRecorder record.EventRecorder, metrics *Metrics) *kindReplicator {
+	kr := &kindReplicator{
+		strategy:        strategy,
+		informer:        strategy.Informer(),
+		queue:           workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter()),
+		workers:         workers,
+		namespaceLister: namespaceLister,
+		eventRecorder:   eventRecorder,
+		metrics:         metrics,
+	}
+
+	kr.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: kr.enqueue,
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			kr.enqueue(newObj)
+		},
+		DeleteFunc: kr.enqueue,
+	})
+
+	if err := kr.informer.AddIndexers(cache.Indexers{
+		replicatedFromIndexName: kr.replicatedFromIndexFunc,
+	}); err != nil {
+		klog.Errorf("Error adding replicated-from indexer for %s: %v", strategy.Kind(), err)
+	}
+
+	return kr
+}
+
+// replicatedFromIndexFunc indexes obj by the value of its replicated-from annotation, if set.
+func (kr *kindReplicator) replicatedFromIndexFunc(obj interface{}) ([]string, error) {
+	replica, ok := obj.(metav1.Object)
+	if !ok {
+		return nil, nil
+	}
+
+	value, ok := replica.GetAnnotations()[kr.annotation(replicatedFromKey)]
+	if !ok {
+		return nil, nil
+	}
+
+	return []string{value}, nil
+}
+
+// enqueue adds the namespace/name key of obj to the workqueue.
+func (kr *kindReplicator) enqueue(obj interface{}) {
+	key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+	if err != nil {
+		utilruntime.HandleError(err)
+		return
+	}
+
+	kr.queue.Add(key)
+}
+
+// enqueueSourcesMatchingNamespace re-enqueues every cached source object whose namespace-selector
+// annotation matches ns, so that a newly created (or relabeled) Namespace is immediately populated
+// with the source objects that target it instead of waiting for the next reconcile.
+func (kr *kindReplicator) enqueueSourcesMatchingNamespace(ns metav1.Object) {
+	for _, obj := range kr.informer.GetStore().List() {
+		source, ok := obj.(metav1.Object)
+		if !ok {
+			continue
+		}
+
+		selectorStr := source.GetAnnotations()[kr.annotation(namespaceSelectorKey)]
+		if selectorStr == "" {
+			continue
+		}
+
+		selector, err := labels.Parse(selectorStr)
+		if err != nil {
+			continue
+		}
+
+		if selector.Matches(labels.Set(ns.GetLabels())) {
+			kr.enqueue(obj)
+		}
+	}
+}
+
+// run starts this kind's workers and blocks until ctx is cancelled.
+func (kr *kindReplicator) run(ctx context.Context) {
+	defer utilruntime.HandleCrash()
+	defer kr.queue.ShutDown()
+
+	klog.Infof("Starting %d %s workers", kr.workers, kr.strategy.Kind())
+	for i := 0; i < kr.workers; i++ {
+		go wait.Until(func() { kr.runWorker(ctx) }, time.Second, ctx.Done())
+	}
+
+	<-ctx.Done()
+}
+
+func (kr *kindReplicator) runWorker(ctx context.Context) {
+	for kr.processNextWorkItem(ctx) {
+	}
+}
+
+func (kr *kindReplicator) processNextWorkItem(ctx context.Context) bool {
+	key, shutdown := kr.queue.Get()
+	if shutdown {
+		return false
+	}
+	defer kr.queue.Done(key)
+
+	if err := kr.syncHandler(ctx, key.(string)); err != nil {
+		klog.Errorf("Error syncing %s %q, requeuing: %v", kr.strategy.Kind(), key, err)
+		kr.queue.AddRateLimited(key)
+		return true
+	}
+
+	kr.queue.Forget(key)
+	return true
+}
+
+// syncHandler reconciles the replicas of the source object identified by key against the lister
+// cache.
+func (kr *kindReplicator) syncHandler(ctx context.Context, key string) error {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	defer func() {
+		kr.metrics.ReconcileDuration.WithLabelValues(kr.strategy.Kind()).Observe(time.Since(start).Seconds())
+	}()
+
+	source, err := kr.strategy.GetCached(namespace, name)
+	if k8sErrors.IsNotFound(err) {
+		klog.Infof("%s %s no longer exists, cleaning up replicas", kr.strategy.Kind(), key)
+		return kr.deleteAcrossNamespaces(ctx, namespace, name)
+	}
+	if err != nil {
+		return err
+	}
+
+	return kr.replicateAcrossNamespaces(ctx, source)
+}
+
+func (kr *kindReplicator) annotation(name string) string {
+	return fmt.Sprintf("%s/%s", kr.strategy.AnnotationPrefix(), name)
+}
+
+func (kr *kindReplicator) validateConfiguration(source metav1.Object) error {
+	allowedNamespaces := kr.getAllowedNamespaces(source)
+	excludedNamespaces := kr.getExcludedNamespaces(source)
+
+	if utils.SlicesOverlap(allowedNamespaces, excludedNamespaces) {
+		return fmt.Errorf("ERROR: Unable to replicate %s %s, cannot have overlaps between allowedNamespaces and excludedNamespaces", kr.strategy.Kind(), source.GetName())
+	}
+
+	return nil
+}
+
+func (kr *kindReplicator) replicateEnabled(source metav1.Object) bool {
+	replicationAllowed, ok := source.GetAnnotations()[kr.annotation(replicationAllowedKey)]
+	if !ok {
+		return false
+	}
+
+	replicationAllowedBool, err := strconv.ParseBool(replicationAllowed)
+	if err != nil {
+		return false
+	}
+
+	return replicationAllowedBool
+}
+
+func (kr *kindReplicator) getAllowedNamespaces(source metav1.Object) []string {
+	allowedNamespaces, ok := source.GetAnnotations()[kr.annotation(allowedNamespacesKey)]
+	if !ok {
+		return []string{}
+	}
+
+	return strings.Split(allowedNamespaces, ",")
+}
+
+func (kr *kindReplicator) getExcludedNamespaces(source metav1.Object) []string {
+	excludedNamespaces, ok := source.GetAnnotations()[kr.annotation(excludedNamespacesKey)]
+	if !ok {
+		return []string{}
+	}
+
+	return strings.Split(excludedNamespaces, ",")
+}
+
+// resolveTargetNamespaces computes the set of namespaces source should be replicated into: the
+// namespace-selector annotation (or every namespace, if unset) intersected with the explicit
+// allow list, minus the exclude list and the source's own namespace.
+func (kr *kindReplicator) resolveTargetNamespaces(source replicatedObject) ([]string, error) {
+	var candidates []*corev1.Namespace
+	var err error
+
+	selectorStr := source.GetAnnotations()[kr.annotation(namespaceSelectorKey)]
+	if selectorStr != "" {
+		selector, parseErr := labels.Parse(selectorStr)
+		if parseErr != nil {
+			return nil, fmt.Errorf("invalid %s annotation: %w", kr.annotation(namespaceSelectorKey), parseErr)
+		}
+
+		candidates, err = kr.namespaceLister.List(selector)
+	} else {
+		candidates, err = kr.namespaceLister.List(labels.Everything())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error listing namespaces: %w", err)
+	}
+
+	allowedNamespaces := kr.getAllowedNamespaces(source)
+	var allowedSet map[string]struct{}
+	if len(allowedNamespaces) > 0 {
+		allowedSet = make(map[string]struct{}, len(allowedNamespaces))
+		for _, ns := range allowedNamespaces {
+			allowedSet[ns] = struct{}{}
+		}
+	}
+
+	excludedNamespaces := kr.getExcludedNamespaces(source)
+
+	targets := make([]string, 0, len(candidates))
+	for _, ns := range candidates {
+		if ns.Name == source.GetNamespace() {
+			continue
+		}
+
+		if allowedSet != nil {
+			if _, ok := allowedSet[ns.Name]; !ok {
+				continue
+			}
+		}
+
+		if utils.ListContains(excludedNamespaces, ns.Name) {
+			klog.Infof("Namespace %s is an excluded Namespace. Not replicating %s %s to Namespace %s.", ns.Name, kr.strategy.Kind(), source.GetName(), ns.Name)
+			kr.eventRecorder.Eventf(source, corev1.EventTypeNormal, EventSkippedNamespace, "Namespace %s is excluded, not replicating %s to it", ns.Name, kr.strategy.Kind())
+			continue
+		}
+
+		targets = append(targets, ns.Name)
+	}
+
+	return targets, nil
+}
+
+// replicateAcrossNamespaces reconciles the replicas of source against its desired set of target
+// namespaces, creating or patching each as needed, and garbage-collects any existing replica of
+// source that has fallen out of that set (e.g. because replication was disabled, or the
+// namespace was excluded).
+func (kr *kindReplicator) replicateAcrossNamespaces(ctx context.Context, source replicatedObject) error {
+	sourceKey := source.GetNamespace() + "_" + source.GetName()
+
+	if err := kr.validateConfiguration(source); err != nil {
+		kr.eventRecorder.Event(source, corev1.EventTypeWarning, EventValidationFailed, err.Error())
+		return err
+	}
+
+	if skip, reason := kr.strategy.ShouldSkip(source); skip {
+		klog.Warningf("Skipping replication of %s %s/%s: %s", kr.strategy.Kind(), source.GetNamespace(), source.GetName(), reason)
+		kr.eventRecorder.Event(source, corev1.EventTypeWarning, EventSkippedNamespace, reason)
+		kr.metrics.ManagedReplicas.WithLabelValues(source.GetNamespace(), source.GetName()).Set(0)
+		return kr.deleteReplicasExcept(ctx, sourceKey, nil, source)
+	}
+
+	if !kr.replicateEnabled(source) {
+		kr.metrics.ManagedReplicas.WithLabelValues(source.GetNamespace(), source.GetName()).Set(0)
+		return kr.deleteReplicasExcept(ctx, sourceKey, nil, source)
+	}
+
+	targets, err := kr.resolveTargetNamespaces(source)
+	if err != nil {
+		kr.eventRecorder.Event(source, corev1.EventTypeWarning, EventValidationFailed, err.Error())
+		return err
+	}
+
+	keep := make(map[string]struct{}, len(targets))
+	for _, ns := range targets {
+		keep[ns] = struct{}{}
+		kr.createOrUpdate(ctx, source, ns)
+	}
+
+	kr.metrics.ManagedReplicas.WithLabelValues(source.GetNamespace(), source.GetName()).Set(float64(len(keep)))
+
+	return kr.deleteReplicasExcept(ctx, sourceKey, keep, source)
+}
+
+// createOrUpdate creates the replica of source in ns if it does not exist yet. If it does exist,
+// it is patched rather than overwritten so that labels/annotations added directly on the replica
+// are preserved.
+func (kr *kindReplicator) createOrUpdate(ctx context.Context, source replicatedObject, ns string) {
+	current, err := kr.strategy.GetLive(ctx, ns, source.GetName())
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			replica := kr.strategy.BuildReplica(source, ns)
+			if err := kr.strategy.Create(ctx, ns, replica); err != nil {
+				klog.Errorf("Error replicating %s to namespace %s: %v", kr.strategy.Kind(), ns, err)
+				kr.metrics.ReplicationsTotal.WithLabelValues("create", "error").Inc()
+				kr.eventRecorder.Eventf(source, corev1.EventTypeWarning, EventReplicatedTo, "Failed to replicate %s to namespace %s: %v", kr.strategy.Kind(), ns, err)
+			} else {
+				klog.Infof("Replicated %s %s to namespace %s", kr.strategy.Kind(), source.GetName(), ns)
+				kr.metrics.ReplicationsTotal.WithLabelValues("create", "success").Inc()
+				kr.eventRecorder.Eventf(source, corev1.EventTypeNormal, EventReplicatedTo, "Replicated %s to namespace %s", kr.strategy.Kind(), ns)
+			}
+
+			return
+		}
+
+		klog.Errorf("Error fetching %s %s in namespace %s: %v", kr.strategy.Kind(), source.GetName(), ns, err)
+		return
+	}
+
+	if !kr.strategy.NeedsUpdate(current, source) {
+		return
+	}
+
+	patch, err := kr.strategy.MergePatch(current, source)
+	if err != nil {
+		klog.Errorf("Error computing merge patch for %s %s in namespace %s: %v", kr.strategy.Kind(), source.GetName(), ns, err)
+		return
+	}
+
+	if err := kr.strategy.Patch(ctx, ns, source.GetName(), patch); err != nil {
+		klog.Errorf("Error replicating %s to namespace %s: %v", kr.strategy.Kind(), ns, err)
+		kr.metrics.ReplicationsTotal.WithLabelValues("update", "error").Inc()
+		kr.eventRecorder.Eventf(source, corev1.EventTypeWarning, EventUpdatedIn, "Failed to update %s in namespace %s: %v", kr.strategy.Kind(), ns, err)
+	} else {
+		klog.Infof("Updated %s %s in namespace %s", kr.strategy.Kind(), source.GetName(), ns)
+		kr.metrics.ReplicationsTotal.WithLabelValues("update", "success").Inc()
+		kr.eventRecorder.Eventf(source, corev1.EventTypeNormal, EventUpdatedIn, "Updated %s in namespace %s", kr.strategy.Kind(), ns)
+	}
+}
+
+// deleteAcrossNamespaces removes every replica stamped as replicated from sourceNamespace/name,
+// now that the source object itself no longer exists.
+func (kr *kindReplicator) deleteAcrossNamespaces(ctx context.Context, sourceNamespace, name string) error {
+	kr.metrics.ManagedReplicas.DeleteLabelValues(sourceNamespace, name)
+	return kr.deleteReplicasExcept(ctx, sourceNamespace+"_"+name, nil, nil)
+}
+
+// deleteReplicasExcept deletes every replica indexed under sourceKey (the replicated-from
+// annotation value, sourceNamespace_sourceName) whose namespace is not in keep. A nil/empty keep
+// deletes every replica of that source. Replicas are looked up via the replicated-from index
+// rather than a blind Delete in every namespace, so a plain-name collision with an object this
+// controller never created is never touched. source is used only to attach DeletedFrom events and
+// may be nil, e.g. when the source object itself no longer exists.
+func (kr *kindReplicator) deleteReplicasExcept(ctx context.Context, sourceKey string, keep map[string]struct{}, source replicatedObject) error {
+	replicas, err := kr.informer.GetIndexer().ByIndex(replicatedFromIndexName, sourceKey)
+	if err != nil {
+		return fmt.Errorf("error listing replicas of %s: %w", sourceKey, err)
+	}
+
+	for _, obj := range replicas {
+		replica, ok := obj.(metav1.Object)
+		if !ok {
+			continue
+		}
+
+		if _, ok := keep[replica.GetNamespace()]; ok {
+			continue
+		}
+
+		if err := kr.strategy.Delete(ctx, replica.GetNamespace(), replica.GetName()); err != nil {
+			if k8sErrors.IsNotFound(err) {
+				continue
+			}
+
+			klog.Errorf("Error deleting %s in namespace %s: %v", kr.strategy.Kind(), replica.GetNamespace(), err)
+			kr.metrics.ReplicationsTotal.WithLabelValues("delete", "error").Inc()
+			continue
+		}
+
+		klog.Infof("Deleted orphaned %s %s in namespace %s", kr.strategy.Kind(), replica.GetName(), replica.GetNamespace())
+		kr.metrics.ReplicationsTotal.WithLabelValues("delete", "success").Inc()
+		if source != nil {
+			kr.eventRecorder.Eventf(source, corev1.EventTypeNormal, EventDeletedFrom, "Deleted orphaned %s from namespace %s", kr.strategy.Kind(), replica.GetNamespace())
+		}
+	}
+
+	return nil
+}
+
+// computeMergePatch returns a JSON merge patch that transforms current into desired.
+func computeMergePatch(current, desired interface{}) ([]byte, error) {
+	currentJSON, err := json.Marshal(current)
+	if err != nil {
+		return nil, err
+	}
+
+	desiredJSON, err := json.Marshal(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	return jsonpatch.CreateMergePatch(currentJSON, desiredJSON)
+}
@@ -0,0 +1,245 @@
+package controller
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes/fake"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+// newTestNamespaceLister seeds a NamespaceLister backed by a fake informer's indexer, without
+// starting the informer, so resolveTargetNamespaces can be exercised against a fixed set of
+// namespaces.
+func newTestNamespaceLister(t *testing.T, namespaces ...*corev1.Namespace) corelisters.NamespaceLister {
+	t.Helper()
+
+	informer := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0).Core().V1().Namespaces()
+	for _, ns := range namespaces {
+		if err := informer.Informer().GetIndexer().Add(ns); err != nil {
+			t.Fatalf("failed to seed namespace %s: %v", ns.Name, err)
+		}
+	}
+
+	return informer.Lister()
+}
+
+func namespace(name string, labels map[string]string) *corev1.Namespace {
+	return &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels}}
+}
+
+func configMapSource(namespace string, annotations map[string]string) *corev1.ConfigMap {
+	return &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: "source", Annotations: annotations}}
+}
+
+func TestResolveTargetNamespaces(t *testing.T) {
+	tests := []struct {
+		name        string
+		namespaces  []*corev1.Namespace
+		sourceNS    string
+		annotations map[string]string
+		want        []string
+		wantErr     bool
+	}{
+		{
+			name:       "no filters replicates to every namespace except source",
+			namespaces: []*corev1.Namespace{namespace("source-ns", nil), namespace("a", nil), namespace("b", nil)},
+			sourceNS:   "source-ns",
+			want:       []string{"a", "b"},
+		},
+		{
+			name:        "allowed-namespaces restricts the target set",
+			namespaces:  []*corev1.Namespace{namespace("source-ns", nil), namespace("a", nil), namespace("b", nil)},
+			sourceNS:    "source-ns",
+			annotations: map[string]string{"configmap-replicator/allowed-namespaces": "a"},
+			want:        []string{"a"},
+		},
+		{
+			name:        "excluded-namespaces removes a namespace from the target set",
+			namespaces:  []*corev1.Namespace{namespace("source-ns", nil), namespace("a", nil), namespace("b", nil)},
+			sourceNS:    "source-ns",
+			annotations: map[string]string{"configmap-replicator/excluded-namespaces": "b"},
+			want:        []string{"a"},
+		},
+		{
+			name:       "allowed and excluded interact: excluded wins within the allowed set",
+			namespaces: []*corev1.Namespace{namespace("source-ns", nil), namespace("a", nil), namespace("b", nil)},
+			sourceNS:   "source-ns",
+			annotations: map[string]string{
+				"configmap-replicator/allowed-namespaces":  "a,b",
+				"configmap-replicator/excluded-namespaces": "b",
+			},
+			want: []string{"a"},
+		},
+		{
+			name: "namespace-selector narrows the candidate namespaces",
+			namespaces: []*corev1.Namespace{
+				namespace("source-ns", nil),
+				namespace("a", map[string]string{"env": "prod"}),
+				namespace("b", map[string]string{"env": "dev"}),
+			},
+			sourceNS:    "source-ns",
+			annotations: map[string]string{"configmap-replicator/namespace-selector": "env=prod"},
+			want:        []string{"a"},
+		},
+		{
+			name:        "invalid namespace-selector annotation returns an error",
+			namespaces:  []*corev1.Namespace{namespace("source-ns", nil)},
+			sourceNS:    "source-ns",
+			annotations: map[string]string{"configmap-replicator/namespace-selector": "..not a selector.."},
+			wantErr:     true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			kr := &kindReplicator{
+				strategy:        &configMapStrategy{},
+				namespaceLister: newTestNamespaceLister(t, tt.namespaces...),
+				eventRecorder:   record.NewFakeRecorder(10),
+			}
+
+			got, err := kr.resolveTargetNamespaces(configMapSource(tt.sourceNS, tt.annotations))
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("resolveTargetNamespaces() expected an error, got none")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolveTargetNamespaces() unexpected error: %v", err)
+			}
+
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("resolveTargetNamespaces() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// fakeReplicatorStrategy is a minimal ReplicatorStrategy used to exercise kindReplicator's
+// index-based garbage collection without a real API client. Only Kind, AnnotationPrefix,
+// Informer and Delete are used by the code under test; the remaining methods are unused stubs.
+type fakeReplicatorStrategy struct {
+	informer cache.SharedIndexInformer
+	deleted  []string
+}
+
+func (f *fakeReplicatorStrategy) Kind() string                         { return "Fake" }
+func (f *fakeReplicatorStrategy) AnnotationPrefix() string             { return "fake-replicator" }
+func (f *fakeReplicatorStrategy) Informer() cache.SharedIndexInformer  { return f.informer }
+func (f *fakeReplicatorStrategy) GetCached(_, _ string) (replicatedObject, error) {
+	return nil, nil
+}
+func (f *fakeReplicatorStrategy) ShouldSkip(replicatedObject) (bool, string) { return false, "" }
+func (f *fakeReplicatorStrategy) BuildReplica(replicatedObject, string) replicatedObject {
+	return nil
+}
+func (f *fakeReplicatorStrategy) NeedsUpdate(replicatedObject, replicatedObject) bool { return false }
+func (f *fakeReplicatorStrategy) MergePatch(replicatedObject, replicatedObject) ([]byte, error) {
+	return nil, nil
+}
+func (f *fakeReplicatorStrategy) GetLive(context.Context, string, string) (replicatedObject, error) {
+	return nil, nil
+}
+func (f *fakeReplicatorStrategy) Create(context.Context, string, replicatedObject) error { return nil }
+func (f *fakeReplicatorStrategy) Patch(context.Context, string, string, []byte) error    { return nil }
+func (f *fakeReplicatorStrategy) Delete(_ context.Context, ns, name string) error {
+	f.deleted = append(f.deleted, ns+"/"+name)
+	return nil
+}
+
+// newFakeKindReplicator builds a kindReplicator backed by fakeReplicatorStrategy, then seeds its
+// informer's indexer with objs, so the replicated-from indexer (registered by newKindReplicator)
+// indexes each of them as it is added.
+func newFakeKindReplicator(t *testing.T, objs ...*corev1.ConfigMap) (*kindReplicator, *fakeReplicatorStrategy) {
+	t.Helper()
+
+	informer := informers.NewSharedInformerFactory(fake.NewSimpleClientset(), 0).Core().V1().ConfigMaps().Informer()
+	strategy := &fakeReplicatorStrategy{informer: informer}
+	kr := newKindReplicator(strategy, 1, nil, record.NewFakeRecorder(10), NewMetrics())
+
+	for _, obj := range objs {
+		if err := informer.GetIndexer().Add(obj); err != nil {
+			t.Fatalf("failed to seed indexer with %s/%s: %v", obj.Namespace, obj.Name, err)
+		}
+	}
+
+	return kr, strategy
+}
+
+func TestReplicatedFromIndexFunc(t *testing.T) {
+	kr, _ := newFakeKindReplicator(t)
+
+	withAnnotation := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      "cm",
+			Namespace: "ns-a",
+			Annotations: map[string]string{
+				"fake-replicator/replicated-from": "source-ns_source-name",
+			},
+		},
+	}
+	keys, err := kr.replicatedFromIndexFunc(withAnnotation)
+	if err != nil {
+		t.Fatalf("replicatedFromIndexFunc() unexpected error: %v", err)
+	}
+	if want := []string{"source-ns_source-name"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("replicatedFromIndexFunc() = %v, want %v", keys, want)
+	}
+
+	withoutAnnotation := &corev1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "cm2", Namespace: "ns-b"}}
+	keys, err = kr.replicatedFromIndexFunc(withoutAnnotation)
+	if err != nil {
+		t.Fatalf("replicatedFromIndexFunc() unexpected error: %v", err)
+	}
+	if keys != nil {
+		t.Errorf("replicatedFromIndexFunc() = %v, want nil", keys)
+	}
+}
+
+func TestDeleteReplicasExcept(t *testing.T) {
+	const sourceKey = "source-ns_source-name"
+
+	keep := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "replica",
+			Namespace:   "ns-1",
+			Annotations: map[string]string{"fake-replicator/replicated-from": sourceKey},
+		},
+	}
+	orphan := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "replica",
+			Namespace:   "ns-2",
+			Annotations: map[string]string{"fake-replicator/replicated-from": sourceKey},
+		},
+	}
+	// Same name as the replicas above, but owned by a different source and living in its own
+	// namespace: a plain-name collision that must survive even though it isn't in keep.
+	collision := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        "replica",
+			Namespace:   "ns-3",
+			Annotations: map[string]string{"fake-replicator/replicated-from": "other-ns_other-name"},
+		},
+	}
+
+	kr, strategy := newFakeKindReplicator(t, keep, orphan, collision)
+
+	if err := kr.deleteReplicasExcept(context.Background(), sourceKey, map[string]struct{}{"ns-1": {}}, nil); err != nil {
+		t.Fatalf("deleteReplicasExcept() unexpected error: %v", err)
+	}
+
+	if want := []string{"ns-2/replica"}; !reflect.DeepEqual(strategy.deleted, want) {
+		t.Errorf("deleteReplicasExcept() deleted = %v, want %v", strategy.deleted, want)
+	}
+}
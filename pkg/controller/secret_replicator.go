@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	corelisters "k8s.io/client-go/listers/core/v1"
+	"k8s.io/client-go/tools/cache"
+	"strconv"
+)
+
+const secretAnnotationPrefix = "secret-replicator"
+
+// allowServiceAccountTokensKey opts a Secret of type kubernetes.io/service-account-token into
+// replication. These Secrets are per-namespace by design and are blocked by default.
+const allowServiceAccountTokensKey = "allow-service-account-tokens"
+
+// secretStrategy implements ReplicatorStrategy for v1.Secret.
+type secretStrategy struct {
+	clientset kubernetes.Interface
+	informer  cache.SharedIndexInformer
+	lister    corelisters.SecretLister
+}
+
+func newSecretStrategy(clientset kubernetes.Interface, informerFactory informers.SharedInformerFactory) *secretStrategy {
+	informer := informerFactory.Core().V1().Secrets()
+
+	return &secretStrategy{
+		clientset: clientset,
+		informer:  informer.Informer(),
+		lister:    informer.Lister(),
+	}
+}
+
+func (s *secretStrategy) Kind() string                        { return "Secret" }
+func (s *secretStrategy) AnnotationPrefix() string             { return secretAnnotationPrefix }
+func (s *secretStrategy) Informer() cache.SharedIndexInformer { return s.informer }
+
+func (s *secretStrategy) GetCached(namespace, name string) (replicatedObject, error) {
+	return s.lister.Secrets(namespace).Get(name)
+}
+
+// ShouldSkip blocks replication of kubernetes.io/service-account-token Secrets unless the source
+// Secret explicitly opts in via the allow-service-account-tokens annotation.
+func (s *secretStrategy) ShouldSkip(source replicatedObject) (bool, string) {
+	secret := source.(*v1.Secret)
+	if secret.Type != v1.SecretTypeServiceAccountToken {
+		return false, ""
+	}
+
+	allowed, _ := strconv.ParseBool(secret.Annotations[fmt.Sprintf("%s/%s", secretAnnotationPrefix, allowServiceAccountTokensKey)])
+	if allowed {
+		return false, ""
+	}
+
+	return true, "Secrets of type kubernetes.io/service-account-token are per-namespace and blocked by default"
+}
+
+func (s *secretStrategy) GetLive(ctx context.Context, ns, name string) (replicatedObject, error) {
+	return s.clientset.CoreV1().Secrets(ns).Get(ctx, name, metav1.GetOptions{})
+}
+
+func (s *secretStrategy) BuildReplica(source replicatedObject, ns string) replicatedObject {
+	secret := source.(*v1.Secret)
+
+	return &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      secret.Name,
+			Namespace: ns,
+			Annotations: map[string]string{
+				fmt.Sprintf("%s/%s", secretAnnotationPrefix, replicatedFromKey): secret.Namespace + "_" + secret.Name,
+			},
+		},
+		Type: secret.Type,
+		Data: secret.Data,
+	}
+}
+
+func (s *secretStrategy) NeedsUpdate(current, source replicatedObject) bool {
+	currentSecret := current.(*v1.Secret)
+	sourceSecret := source.(*v1.Secret)
+	replicatedFromAnnotation := fmt.Sprintf("%s/%s", secretAnnotationPrefix, replicatedFromKey)
+	replicatedFromValue := sourceSecret.Namespace + "_" + sourceSecret.Name
+
+	return !equality.Semantic.DeepEqual(currentSecret.Data, sourceSecret.Data) ||
+		currentSecret.Annotations[replicatedFromAnnotation] != replicatedFromValue
+}
+
+func (s *secretStrategy) MergePatch(current, source replicatedObject) ([]byte, error) {
+	currentSecret := current.(*v1.Secret)
+	sourceSecret := source.(*v1.Secret)
+
+	// Type is immutable on Secrets once created, so it is intentionally left out of the patch.
+	desired := currentSecret.DeepCopy()
+	desired.Data = sourceSecret.Data
+	if desired.Annotations == nil {
+		desired.Annotations = map[string]string{}
+	}
+	desired.Annotations[fmt.Sprintf("%s/%s", secretAnnotationPrefix, replicatedFromKey)] = sourceSecret.Namespace + "_" + sourceSecret.Name
+
+	return computeMergePatch(currentSecret, desired)
+}
+
+func (s *secretStrategy) Create(ctx context.Context, ns string, replica replicatedObject) error {
+	_, err := s.clientset.CoreV1().Secrets(ns).Create(ctx, replica.(*v1.Secret), metav1.CreateOptions{})
+	return err
+}
+
+func (s *secretStrategy) Patch(ctx context.Context, ns, name string, patch []byte) error {
+	_, err := s.clientset.CoreV1().Secrets(ns).Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	return err
+}
+
+func (s *secretStrategy) Delete(ctx context.Context, ns, name string) error {
+	return s.clientset.CoreV1().Secrets(ns).Delete(ctx, name, metav1.DeleteOptions{})
+}
@@ -0,0 +1,34 @@
+package utils
+
+import "os"
+
+// ListContains returns true if the given slice contains the given element.
+func ListContains(s []string, e string) bool {
+	for _, item := range s {
+		if item == e {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SlicesOverlap returns true if slice1 and slice2 share at least one element.
+func SlicesOverlap(slice1 []string, slice2 []string) bool {
+	for _, item := range slice1 {
+		if ListContains(slice2, item) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GetEnv returns the value of the given environment variable, or fallback if it is not set.
+func GetEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+
+	return fallback
+}